@@ -1 +1,24 @@
-from .client import AsyncClient, LLMMeta, Message
+from .client import (
+    AsyncClient,
+    CassetteNotFoundError,
+    ContentPolicyError,
+    ContextLengthExceededError,
+    ErrorCategory,
+    ImagePart,
+    InMemoryResponseCache,
+    LLMAuthenticationError,
+    LLMError,
+    LLMMeta,
+    LLMRateLimitError,
+    LLMTimeoutError,
+    Message,
+    MockClient,
+    QueueTimeoutError,
+    RecordingClient,
+    RedisResponseCache,
+    ReplayClient,
+    RequestLimiter,
+    TextPart,
+    estimate_tokens,
+    window_messages,
+)
@@ -1 +1,15 @@
-from .client import AsyncClient, LLMMeta, LLMUsageTracker, Message
+from .cache import InMemoryResponseCache, RedisResponseCache, ResponseCache
+from .client import AsyncClient, ImagePart, LLMMeta, LLMUsageTracker, Message, TextPart
+from .errors import (
+    ContentPolicyError,
+    ContextLengthExceededError,
+    ErrorCategory,
+    LLMAuthenticationError,
+    LLMError,
+    LLMRateLimitError,
+    LLMTimeoutError,
+)
+from .limiter import QueueTimeoutError, RequestLimiter
+from .mock import MockClient
+from .recorder import CassetteNotFoundError, RecordingClient, ReplayClient
+from .window import estimate_tokens, window_messages
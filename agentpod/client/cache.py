@@ -0,0 +1,77 @@
+import hashlib
+import json
+import time
+from enum import Enum
+from typing import Any, Optional, Protocol, Type
+
+
+class ResponseCache(Protocol):
+    """Storage for serialized completion responses. Values are JSON strings."""
+
+    async def get(self, key: str) -> Optional[str]: ...
+
+    async def set(self, key: str, value: str, ttl: float) -> None: ...
+
+
+def request_hash(model: Any, messages: list, output_type: Optional[Type] = None, **params: Any) -> str:
+    """
+    Builds a stable hash for a completion request from everything that influences the response.
+
+    Args:
+        model (Any): The model the request is sent to, as a string or LLMMeta.
+        messages (list): The Messages sent to the model.
+        output_type (Optional[Type]): The structured output type, if any.
+        **params: Any other request parameters, e.g. stream=True. Empty values are ignored.
+
+    Returns:
+        str: A hex digest that is identical for identical requests.
+    """
+    payload = {
+        "model": model.value if isinstance(model, Enum) else model,
+        "messages": [message.to_dict() for message in messages],
+        "output_schema": output_type.model_json_schema() if output_type else None,
+        "params": {key: value for key, value in params.items() if value not in (None, {}, [])},
+    }
+    return hashlib.sha256(json.dumps(payload, sort_keys=True, default=str).encode()).hexdigest()
+
+
+class InMemoryResponseCache:
+    def __init__(self, max_entries: int = 1024):
+        if max_entries < 1:
+            raise ValueError("max_entries must be at least 1.")
+        self.max_entries = max_entries
+        self._entries: dict[str, tuple[float, str]] = {}
+
+    async def get(self, key: str) -> Optional[str]:
+        entry = self._entries.get(key)
+        if entry is None:
+            return None
+        expires_at, value = entry
+        if expires_at < time.monotonic():
+            del self._entries[key]
+            return None
+        return value
+
+    async def set(self, key: str, value: str, ttl: float) -> None:
+        self._entries.pop(key, None)
+        if len(self._entries) >= self.max_entries:
+            # dicts keep insertion order, so the first key is the oldest entry
+            del self._entries[next(iter(self._entries))]
+        self._entries[key] = (time.monotonic() + ttl, value)
+
+
+class RedisResponseCache:
+    """Backed by a `redis.asyncio.Redis` client, so the cache can be shared between processes."""
+
+    def __init__(self, redis: Any, prefix: str = "agentpod:response:"):
+        self.redis = redis
+        self.prefix = prefix
+
+    async def get(self, key: str) -> Optional[str]:
+        value = await self.redis.get(self.prefix + key)
+        if isinstance(value, bytes):
+            return value.decode()
+        return value
+
+    async def set(self, key: str, value: str, ttl: float) -> None:
+        await self.redis.set(self.prefix + key, value, ex=max(1, int(ttl)))
@@ -1,26 +1,92 @@
 import asyncio
+import base64
 import os
+from contextlib import nullcontext
 from enum import Enum
-from typing import AsyncGenerator, Literal, Optional, Type, Union
-
-from openai import AsyncOpenAI
+from typing import (
+    IO,
+    Annotated,
+    Any,
+    AsyncContextManager,
+    AsyncGenerator,
+    Awaitable,
+    Callable,
+    Literal,
+    Optional,
+    Type,
+    TypeVar,
+    Union,
+)
+
+import openai
+from loguru import logger
+from openai import NOT_GIVEN, AsyncOpenAI
 from pydantic import BaseModel, Field
 
+from agentpod.client.cache import ResponseCache, request_hash
+from agentpod.client.errors import ContextLengthExceededError, normalize_error
+from agentpod.client.limiter import RequestLimiter
 from agentpod.client.structured.custom_async_openai import CustomAsyncOpenAI
 from agentpod.client.structured.mode import Mode
 from agentpod.client.structured.patch import patch
+from agentpod.client.window import estimate_tokens, window_messages
+
+T = TypeVar("T")
+
+# Each retry after a context length error keeps roughly this share of the previous prompt
+TRUNCATION_RATIO = 0.75
+
+# Used by deterministic clients when no seed is given, so runs are repeatable by default
+DETERMINISTIC_SEED = 42
+
+
+class TextPart(BaseModel):
+    type: Literal["text"] = "text"
+    text: str
+
+
+class ImageURL(BaseModel):
+    url: str
+    detail: Literal["auto", "low", "high"] = "auto"
+
+
+class ImagePart(BaseModel):
+    type: Literal["image_url"] = "image_url"
+    image_url: ImageURL
+
+    @classmethod
+    def from_url(cls, url: str, detail: Literal["auto", "low", "high"] = "auto") -> "ImagePart":
+        return cls(image_url=ImageURL(url=url, detail=detail))
+
+    @classmethod
+    def from_bytes(
+        cls, data: bytes, mime_type: str = "image/png", detail: Literal["auto", "low", "high"] = "auto"
+    ) -> "ImagePart":
+        encoded = base64.b64encode(data).decode()
+        return cls.from_url(f"data:{mime_type};base64,{encoded}", detail=detail)
+
+
+ContentPart = Annotated[Union[TextPart, ImagePart], Field(discriminator="type")]
 
 
 class Message(BaseModel):
     role: Literal["user", "assistant", "system"]
-    content: str
+    content: Union[str, list[ContentPart]]
+
+    @classmethod
+    def with_images(cls, text: str, images: list[ImagePart]) -> "Message":
+        return cls(role="user", content=[TextPart(text=text), *images])
+
+    @property
+    def has_images(self) -> bool:
+        return isinstance(self.content, list) and any(isinstance(part, ImagePart) for part in self.content)
 
     def to_dict(self) -> dict[
         Literal[
             "role",
             "content",
         ],
-        str,
+        Union[str, list[dict]],
     ]:
         return self.model_dump()
 
@@ -36,6 +102,21 @@ MODEL_COSTS = {
     "gpt-3.5-turbo-instruct": {"input": 1.50, "output": 2.00},
 }
 
+# Prompt tokens served from the provider's prompt cache are billed at a fraction of the input price
+CACHED_INPUT_DISCOUNT = 0.5
+
+# Transcription is billed per minute of audio
+TRANSCRIPTION_COSTS = {
+    "whisper-1": 0.006,
+}
+
+VISION_MODELS = {
+    "gpt-4o",
+    "gpt-4o-2024-05-13",
+    "gpt-4-turbo",
+    "gpt-4-turbo-2024-04-09",
+}
+
 
 class LLMMeta(Enum):
     GPT_4O = "gpt-4o"
@@ -51,12 +132,18 @@ class LLMMeta(Enum):
     def get_model_cost(cls, model):
         return MODEL_COSTS[model.value]
 
+    @classmethod
+    def supports_vision(cls, model):
+        return model.value in VISION_MODELS
+
 
 class LLMUsageTracker:
     def __init__(self):
         self.completion_tokens: int = 0
         self.prompt_tokens: int = 0
+        self.cached_prompt_tokens: int = 0
         self.total_tokens: int = 0
+        self.audio_seconds: float = 0.0
         self.total_cost: float = 0.0
         self.active: bool = False
 
@@ -74,37 +161,130 @@ class LLMUsageTracker:
 
         model_costs = LLMMeta.get_model_cost(model)
 
+        # Older SDK versions and some providers don't report prompt_tokens_details
+        prompt_tokens_details = getattr(usage, "prompt_tokens_details", None)
+        cached_tokens = getattr(prompt_tokens_details, "cached_tokens", None) or 0
+
         self.completion_tokens += usage.completion_tokens
         self.prompt_tokens += usage.prompt_tokens
+        self.cached_prompt_tokens += cached_tokens
         self.total_tokens += usage.total_tokens
 
         input_cost_per_token = model_costs["input"] / 1_000_000
         output_cost_per_token = model_costs["output"] / 1_000_000
 
-        self.total_cost += (usage.prompt_tokens * input_cost_per_token) + (
-            usage.completion_tokens * output_cost_per_token
+        self.total_cost += (
+            ((usage.prompt_tokens - cached_tokens) * input_cost_per_token)
+            + (cached_tokens * input_cost_per_token * CACHED_INPUT_DISCOUNT)
+            + (usage.completion_tokens * output_cost_per_token)
         )
 
+    def update_transcription(self, duration: float, model: str):
+        self.audio_seconds += duration
+        self.total_cost += (duration / 60) * TRANSCRIPTION_COSTS[model]
+
     def reset(self):
         self.completion_tokens = 0
         self.prompt_tokens = 0
+        self.cached_prompt_tokens = 0
         self.total_tokens = 0
+        self.audio_seconds = 0.0
         self.total_cost = 0.0
 
     def __repr__(self):
         return (
             f"UsageTracker(completion_tokens={self.completion_tokens}, "
-            f"prompt_tokens={self.prompt_tokens}, total_tokens={self.total_tokens}, "
-            f"total_cost={self.total_cost:.6f})"
+            f"prompt_tokens={self.prompt_tokens}, cached_prompt_tokens={self.cached_prompt_tokens}, "
+            f"total_tokens={self.total_tokens}, "
+            f"audio_seconds={self.audio_seconds:.1f}, total_cost={self.total_cost:.6f})"
+        )
+
+
+class RequestConfig:
+    """
+    The client-level settings that shape a request: the model, provider params and sampling.
+
+    Shared by AsyncClient and ReplayClient so a request is cached, recorded and replayed under the same key.
+    """
+
+    def __init__(
+        self,
+        model: Union[str, LLMMeta] = LLMMeta.GPT_3_5_TURBO_INSTRUCT,
+        provider_params: Optional[dict[str, Any]] = None,
+        temperature: Optional[float] = None,
+        seed: Optional[int] = None,
+        deterministic: bool = False,
+    ):
+        if isinstance(model, str):
+            try:
+                self.model = LLMMeta[model.upper().replace("-", "_")]
+            except KeyError:
+                raise ValueError(f"Unsupported model type: {model}")
+        else:
+            self.model = model
+
+        self.provider_params = provider_params or {}
+
+        # Deterministic mode pins sampling so eval runs and bug reproductions repeat as far as the provider allows
+        if deterministic:
+            temperature = 0.0 if temperature is None else temperature
+            seed = DETERMINISTIC_SEED if seed is None else seed
+        self.temperature = temperature
+        self.seed = seed
+
+    def _provider_params(self, provider_params: Optional[dict[str, Any]]) -> dict[str, Any]:
+        return {**self.provider_params, **(provider_params or {})}
+
+    def _sampling_params(self, seed: Optional[int]) -> dict[str, Any]:
+        params = {"temperature": self.temperature, "seed": self.seed if seed is None else seed}
+        return {key: value for key, value in params.items() if value is not None}
+
+    def request_key(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
+        stream: bool = False,
+    ) -> str:
+        """
+        Builds the key a request is cached, recorded and replayed under.
+
+        Args:
+            messages (list[Message]): The messages sent to the model.
+            output_type (Optional[Type[BaseModel]]): The structured output type, if any.
+            provider_params (Optional[dict[str, Any]]): The per-call provider params, merged over the client's.
+            seed (Optional[int]): The per-call seed, overriding the client's.
+            stream (bool): Whether the response is streamed.
+
+        Returns:
+            str: The request_hash of everything sent to the provider that influences the response.
+        """
+        return request_hash(
+            self.model,
+            messages,
+            output_type,
+            stream=stream,
+            provider_params=self._provider_params(provider_params),
+            **self._sampling_params(seed),
         )
 
 
-class AsyncClient:
+class AsyncClient(RequestConfig):
     def __init__(
         self,
         api_key: Optional[str] = "",
         provider: Optional[str] = "openai",
         model: Union[str, LLMMeta] = LLMMeta.GPT_3_5_TURBO_INSTRUCT,
+        limiter: Optional[RequestLimiter] = None,
+        cache: Optional[ResponseCache] = None,
+        cache_ttl: float = 3600,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        auto_truncate: bool = False,
+        temperature: Optional[float] = None,
+        seed: Optional[int] = None,
+        deterministic: bool = False,
     ):
         if provider.lower() != "openai":
             raise ValueError("Currently, only 'openai' provider is supported.")
@@ -124,47 +304,139 @@ class AsyncClient:
             provider=provider,
         )
 
-        if isinstance(model, str):
-            try:
-                self.model = LLMMeta[model.upper().replace("-", "_")]
-            except KeyError:
-                raise ValueError(f"Unsupported model type: {model}")
-        else:
-            self.model = model
+        super().__init__(
+            model=model,
+            provider_params=provider_params,
+            temperature=temperature,
+            seed=seed,
+            deterministic=deterministic,
+        )
 
         self.usage_tracker = LLMUsageTracker()  # Initialize the usage tracker here
+        self.limiter = limiter
+        self.cache = cache
+        self.cache_ttl = cache_ttl
+        self.prompt_cache_key = prompt_cache_key
+        self.auto_truncate = auto_truncate
+
+    def _slot(self, model: str) -> AsyncContextManager:
+        return self.limiter.acquire(model) if self.limiter else nullcontext()
+
+    def _extra_body(self, prompt_cache_key: Optional[str], provider_params: Optional[dict[str, Any]]) -> Optional[dict]:
+        # Fields the pinned SDK version doesn't name are sent as extra body fields, provider params last so they win
+        extra_body = {}
+        prompt_cache_key = prompt_cache_key or self.prompt_cache_key
+        if prompt_cache_key:
+            extra_body["prompt_cache_key"] = prompt_cache_key
+        extra_body.update(self._provider_params(provider_params))
+        return extra_body or None
+
+    def _truncate(self, messages: list[Message]) -> Optional[list[Message]]:
+        budget = int(sum(estimate_tokens(message) for message in messages) * TRUNCATION_RATIO)
+        truncated = window_messages(messages, budget)
+        return truncated if len(truncated) < len(messages) else None
+
+    async def _fit_context(self, request: Callable[[list[Message]], Awaitable[T]], messages: list[Message]) -> T:
+        # Retries the request with fewer messages for as long as the provider says they don't fit
+        while True:
+            try:
+                return await request(messages)
+            except ContextLengthExceededError:
+                if not self.auto_truncate:
+                    raise
+                truncated = self._truncate(messages)
+                if truncated is None:
+                    raise
+                logger.warning(
+                    f"Context length exceeded for {self.model.value}, retrying with "
+                    f"{len(truncated)} of {len(messages)} messages"
+                )
+                messages = truncated
+
+    def _check_vision(self, messages: list[Message]):
+        if not LLMMeta.supports_vision(self.model) and any(message.has_images for message in messages):
+            raise ValueError(f"Model {self.model.value} does not support image inputs.")
 
     async def invoke(
-        self, messages: list[Message], output_type: Optional[Type[BaseModel]] = None, max_retries: Optional[int] = 3
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
     ) -> Message | BaseModel:
-        if output_type:
-            response = await self._structured_client.chat.completions.create(
-                model=self.model.value,
-                messages=[message.to_dict() for message in messages],
-                response_model=output_type,
-                stream=False,
-                raw_processor_fn=lambda original: (
-                    (
-                        self.usage_tracker.update(original.usage, self.provider, self.model)
-                        if original.usage and self.usage_tracker.active
-                        else None
-                    ),
-                ),
-                max_retries=max_retries,
-            )
-            return response
-        else:
-            response = await self._native_client.chat.completions.create(
-                model=self.model.value,
-                messages=[message.to_dict() for message in messages],
-                stream=False,
-            )
-            if response.usage and self.usage_tracker.active:
-                self.usage_tracker.update(response.usage, self.provider, self.model)
+        if not self.cache:
+            return await self._invoke(messages, output_type, max_retries, prompt_cache_key, provider_params, seed)
+
+        key = self.request_key(messages, output_type, provider_params=provider_params, seed=seed)
+        cached = await self.cache.get(key)
+        if cached is not None:
+            return (output_type or Message).model_validate_json(cached)
+        response = await self._invoke(messages, output_type, max_retries, prompt_cache_key, provider_params, seed)
+        await self.cache.set(key, response.model_dump_json(), self.cache_ttl)
+        return response
+
+    async def _invoke(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]],
+        max_retries: Optional[int],
+        prompt_cache_key: Optional[str],
+        provider_params: Optional[dict[str, Any]],
+        seed: Optional[int],
+    ) -> Message | BaseModel:
+        return await self._fit_context(
+            lambda messages: self._request(messages, output_type, max_retries, prompt_cache_key, provider_params, seed),
+            messages,
+        )
 
-            # Craft a Message response from the response variable
-            choice = response.choices[0]
-            return Message(role=choice.message.role, content=choice.message.content)
+    async def _request(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]],
+        max_retries: Optional[int],
+        prompt_cache_key: Optional[str],
+        provider_params: Optional[dict[str, Any]],
+        seed: Optional[int],
+    ) -> Message | BaseModel:
+        self._check_vision(messages)
+        try:
+            async with self._slot(self.model.value):
+                if output_type:
+                    response = await self._structured_client.chat.completions.create(
+                        model=self.model.value,
+                        messages=[message.to_dict() for message in messages],
+                        response_model=output_type,
+                        stream=False,
+                        extra_body=self._extra_body(prompt_cache_key, provider_params),
+                        **self._sampling_params(seed),
+                        raw_processor_fn=lambda original: (
+                            (
+                                self.usage_tracker.update(original.usage, self.provider, self.model)
+                                if original.usage and self.usage_tracker.active
+                                else None
+                            ),
+                        ),
+                        max_retries=max_retries,
+                    )
+                    return response
+                else:
+                    response = await self._native_client.chat.completions.create(
+                        model=self.model.value,
+                        messages=[message.to_dict() for message in messages],
+                        stream=False,
+                        extra_body=self._extra_body(prompt_cache_key, provider_params),
+                        **self._sampling_params(seed),
+                    )
+                    if response.usage and self.usage_tracker.active:
+                        self.usage_tracker.update(response.usage, self.provider, self.model)
+
+                    # Craft a Message response from the response variable
+                    choice = response.choices[0]
+                    return Message(role=choice.message.role, content=choice.message.content)
+        except openai.APIError as e:
+            raise normalize_error(e, self.provider) from e
 
     async def stream(
         self,
@@ -172,29 +444,91 @@ class AsyncClient:
         output_type: Optional[Type[BaseModel]] = None,
         partial: Optional[bool] = False,
         max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
     ) -> AsyncGenerator[Message, None]:
+        self._check_vision(messages)
         if output_type:
             # TODO use max retries and partial. For partial, create a structured.Partial type and pass it. Rest is handled internally
             raise NotImplementedError
         else:
-            response = await self._native_client.chat.completions.create(
+            async with self._slot(self.model.value):
+                response = await self._fit_context(
+                    lambda messages: self._create_stream(messages, prompt_cache_key, provider_params, seed),
+                    messages,
+                )
+                try:
+                    first_chunk = True
+                    role = None
+                    async for chunk in response:
+                        if chunk.usage and not chunk.choices and self.usage_tracker.active:
+                            self.usage_tracker.update(chunk.usage, self.provider, self.model)
+                        if chunk.choices:
+                            choice = chunk.choices[0]
+                            if first_chunk:
+                                role = choice.delta.role
+                                first_chunk = False
+                            content = choice.delta.content if choice.delta.content else ""
+                            yield Message(role=role, content=content)
+                except openai.APIError as e:
+                    raise normalize_error(e, self.provider) from e
+
+    async def _create_stream(
+        self,
+        messages: list[Message],
+        prompt_cache_key: Optional[str],
+        provider_params: Optional[dict[str, Any]],
+        seed: Optional[int],
+    ) -> openai.AsyncStream:
+        try:
+            return await self._native_client.chat.completions.create(
                 model=self.model.value,
                 messages=[message.to_dict() for message in messages],
                 stream=True,
                 stream_options={"include_usage": True},
+                extra_body=self._extra_body(prompt_cache_key, provider_params),
+                **self._sampling_params(seed),
             )
-            first_chunk = True
-            role = None
-            async for chunk in response:
-                if chunk.usage and not chunk.choices and self.usage_tracker.active:
-                    self.usage_tracker.update(chunk.usage, self.provider, self.model)
-                if chunk.choices:
-                    choice = chunk.choices[0]
-                    if first_chunk:
-                        role = choice.delta.role
-                        first_chunk = False
-                    content = choice.delta.content if choice.delta.content else ""
-                    yield Message(role=role, content=content)
+        except openai.APIError as e:
+            raise normalize_error(e, self.provider) from e
+
+    async def transcribe(
+        self,
+        audio: Union[IO[bytes], tuple[str, bytes]],
+        model: str = "whisper-1",
+        language: Optional[str] = None,
+    ) -> str:
+        """
+        Transcribes speech to text with a Whisper-compatible endpoint, so audio can be fed into invoke/stream.
+
+        Args:
+            audio (Union[IO[bytes], tuple[str, bytes]]): An open audio file, or a (filename, content) tuple.
+            model (str): The transcription model to use.
+            language (Optional[str]): ISO-639-1 code of the spoken language, improves accuracy when known.
+
+        Returns:
+            str: The transcript.
+        """
+        # verbose_json is only requested to get the audio duration for cost tracking, not every model supports it
+        track_cost = model in TRANSCRIPTION_COSTS
+        if not track_cost:
+            logger.warning(f"No price known for transcription model {model}, its cost won't be tracked")
+        try:
+            async with self._slot(model):
+                response = await self._native_client.audio.transcriptions.create(
+                    model=model,
+                    file=audio,
+                    language=language or NOT_GIVEN,
+                    response_format="verbose_json" if track_cost else "json",
+                )
+        except openai.APIError as e:
+            raise normalize_error(e, self.provider) from e
+
+        duration = getattr(response, "duration", None)
+        if track_cost and duration is not None and self.usage_tracker.active:
+            self.usage_tracker.update_transcription(duration, model)
+        return response.text
 
 
 if __name__ == "__main__":
@@ -0,0 +1,153 @@
+from enum import Enum
+from typing import Optional
+
+import openai
+
+
+class ErrorCategory(Enum):
+    RATE_LIMIT = "rate_limit"
+    CONTEXT_LENGTH_EXCEEDED = "context_length_exceeded"
+    CONTENT_POLICY = "content_policy"
+    AUTHENTICATION = "authentication"
+    PERMISSION = "permission"
+    NOT_FOUND = "not_found"
+    BAD_REQUEST = "bad_request"
+    TIMEOUT = "timeout"
+    CONNECTION = "connection"
+    SERVER = "server"
+    UNKNOWN = "unknown"
+
+
+class LLMError(Exception):
+    """A provider error normalized into a category that callers can branch on."""
+
+    def __init__(
+        self,
+        message: str,
+        category: ErrorCategory,
+        provider: str,
+        status_code: Optional[int] = None,
+        retry_after: Optional[float] = None,
+        request_id: Optional[str] = None,
+    ):
+        self.message = message
+        self.category = category
+        self.provider = provider
+        self.status_code = status_code
+        self.retry_after = retry_after
+        self.request_id = request_id
+        super().__init__(message)
+
+    def __repr__(self):
+        return (
+            f"{type(self).__name__}(category={self.category.value}, provider={self.provider}, "
+            f"status_code={self.status_code}, retry_after={self.retry_after}, "
+            f"request_id={self.request_id}, message={self.message!r})"
+        )
+
+
+class LLMRateLimitError(LLMError):
+    """The provider rejected the request for exceeding a rate or quota limit. Wait `retry_after` seconds if set."""
+
+
+class ContextLengthExceededError(LLMError):
+    """The prompt plus requested completion doesn't fit in the model's context window."""
+
+
+class ContentPolicyError(LLMError):
+    """The prompt or completion was blocked by the provider's content filter."""
+
+
+class LLMAuthenticationError(LLMError):
+    """The API key is missing, invalid, or not allowed to use the model."""
+
+
+class LLMTimeoutError(LLMError):
+    """The provider did not respond in time."""
+
+
+_CATEGORY_ERRORS: dict[ErrorCategory, type[LLMError]] = {
+    ErrorCategory.RATE_LIMIT: LLMRateLimitError,
+    ErrorCategory.CONTEXT_LENGTH_EXCEEDED: ContextLengthExceededError,
+    ErrorCategory.CONTENT_POLICY: ContentPolicyError,
+    ErrorCategory.AUTHENTICATION: LLMAuthenticationError,
+    ErrorCategory.PERMISSION: LLMAuthenticationError,
+    ErrorCategory.TIMEOUT: LLMTimeoutError,
+}
+
+
+def _make_error(message: str, category: ErrorCategory, provider: str, **kwargs) -> LLMError:
+    error_class = _CATEGORY_ERRORS.get(category, LLMError)
+    return error_class(message, category, provider, **kwargs)
+
+
+# Error codes and message fragments used by OpenAI, Azure OpenAI and OpenAI-compatible proxies
+_CONTEXT_LENGTH_MARKERS = ("context_length_exceeded", "maximum context length", "ContextWindowExceededError")
+_CONTENT_POLICY_MARKERS = ("content_policy_violation", "content_filter", "ContentPolicyViolationError")
+
+_STATUS_CATEGORIES = {
+    400: ErrorCategory.BAD_REQUEST,
+    401: ErrorCategory.AUTHENTICATION,
+    403: ErrorCategory.PERMISSION,
+    404: ErrorCategory.NOT_FOUND,
+    408: ErrorCategory.TIMEOUT,
+    429: ErrorCategory.RATE_LIMIT,
+}
+
+
+def _parse_retry_after(value: Optional[str]) -> Optional[float]:
+    if value is None:
+        return None
+    try:
+        return float(value)
+    except ValueError:
+        return None
+
+
+def normalize_error(error: Exception, provider: str) -> LLMError:
+    """
+    Maps an exception raised by the provider SDK into an LLMError.
+
+    Args:
+        error (Exception): The exception raised while talking to the provider.
+        provider (str): The provider the request was sent to.
+
+    Returns:
+        LLMError: The normalized error, as the LLMError subclass matching its category when there is one.
+            The original exception should be chained with `raise ... from error`.
+    """
+    message = str(error)
+
+    if isinstance(error, openai.APITimeoutError):
+        return _make_error(message, ErrorCategory.TIMEOUT, provider)
+    if isinstance(error, openai.APIConnectionError):
+        return _make_error(message, ErrorCategory.CONNECTION, provider)
+    if not isinstance(error, openai.APIStatusError):
+        return _make_error(message, ErrorCategory.UNKNOWN, provider)
+
+    headers = error.response.headers
+    status_code = error.status_code
+    retry_after = _parse_retry_after(headers.get("retry-after"))
+    request_id = headers.get("x-request-id")
+
+    # The error code lives in the body for OpenAI and Azure, proxies tend to only put it in the message
+    body = error.body if isinstance(error.body, dict) else {}
+    details = " ".join(str(part) for part in (body.get("code"), body.get("type"), message) if part)
+
+    if any(marker in details for marker in _CONTEXT_LENGTH_MARKERS):
+        category = ErrorCategory.CONTEXT_LENGTH_EXCEEDED
+    elif any(marker in details for marker in _CONTENT_POLICY_MARKERS):
+        category = ErrorCategory.CONTENT_POLICY
+    elif status_code >= 500:
+        category = ErrorCategory.SERVER
+    else:
+        category = _STATUS_CATEGORIES.get(status_code, ErrorCategory.UNKNOWN)
+
+    return _make_error(
+        message,
+        category,
+        provider,
+        status_code=status_code,
+        retry_after=retry_after,
+        request_id=request_id,
+    )
@@ -0,0 +1,73 @@
+import asyncio
+from collections import defaultdict
+from contextlib import asynccontextmanager
+from typing import AsyncIterator, Optional
+
+
+class QueueTimeoutError(TimeoutError):
+    """Raised when a request waits longer than the limiter's timeout for a free slot."""
+
+
+class RequestLimiter:
+    """
+    Caps the number of concurrent provider requests, globally and per model.
+
+    Share one instance between AsyncClients to apply the limits across all of them. Requests that
+    cannot get a slot wait in a queue; `queue_depth` and `in_flight` can be exported as metrics
+    for autoscaling.
+    """
+
+    def __init__(
+        self,
+        max_concurrency: Optional[int] = None,
+        max_concurrency_per_model: Optional[dict[str, int]] = None,
+        timeout: Optional[float] = None,
+    ):
+        if max_concurrency is not None and max_concurrency < 1:
+            raise ValueError("max_concurrency must be at least 1.")
+        for model, limit in (max_concurrency_per_model or {}).items():
+            if limit < 1:
+                raise ValueError(f"max_concurrency_per_model for {model} must be at least 1.")
+
+        self.timeout = timeout
+        self._global = asyncio.Semaphore(max_concurrency) if max_concurrency is not None else None
+        self._per_model = {model: asyncio.Semaphore(limit) for model, limit in (max_concurrency_per_model or {}).items()}
+        self.queue_depth: int = 0
+        self.in_flight: int = 0
+        self.queue_depth_per_model: dict[str, int] = defaultdict(int)
+
+    @asynccontextmanager
+    async def acquire(self, model: str) -> AsyncIterator[None]:
+        # Take the model slot first so a request queued on a busy model doesn't hold a global slot
+        semaphores = [semaphore for semaphore in (self._per_model.get(model), self._global) if semaphore]
+        acquired: list[asyncio.Semaphore] = []
+
+        self.queue_depth += 1
+        self.queue_depth_per_model[model] += 1
+        try:
+            async with asyncio.timeout(self.timeout):
+                for semaphore in semaphores:
+                    await semaphore.acquire()
+                    acquired.append(semaphore)
+        except TimeoutError:
+            for semaphore in acquired:
+                semaphore.release()
+            raise QueueTimeoutError(f"Timed out after {self.timeout}s waiting for a request slot for {model}")
+        except BaseException:
+            for semaphore in acquired:
+                semaphore.release()
+            raise
+        finally:
+            self.queue_depth -= 1
+            self.queue_depth_per_model[model] -= 1
+
+        self.in_flight += 1
+        try:
+            yield
+        finally:
+            self.in_flight -= 1
+            for semaphore in acquired:
+                semaphore.release()
+
+    def __repr__(self):
+        return f"RequestLimiter(queue_depth={self.queue_depth}, in_flight={self.in_flight})"
@@ -0,0 +1,103 @@
+from typing import IO, Any, AsyncGenerator, Optional, Type, Union
+
+from pydantic import BaseModel
+
+from agentpod.client.client import LLMMeta, LLMUsageTracker, Message
+
+ScriptedResponse = Union[str, list[str], dict, Message, BaseModel, Exception]
+
+
+class MockClient:
+    """
+    A drop-in replacement for AsyncClient that returns scripted responses instead of calling a provider.
+
+    Each call to invoke or stream consumes the next entry of `responses`:
+
+    - str or Message: returned as the assistant message (streamed as a single chunk)
+    - list[str]: streamed chunk by chunk, or joined when passed to invoke
+    - dict or BaseModel: returned as the structured output when `output_type` is given
+    - Exception: raised, to simulate provider failures
+
+    Every call's messages are appended to `calls` so tests can assert on what was sent. transcribe consumes
+    a str entry as the transcript and records its (model, language) in `transcriptions` instead.
+    """
+
+    def __init__(self, responses: list[ScriptedResponse], model: LLMMeta = LLMMeta.GPT_3_5_TURBO_INSTRUCT):
+        self.responses = list(responses)
+        self.model = model
+        self.calls: list[list[Message]] = []
+        self.transcriptions: list[tuple[str, Optional[str]]] = []
+        self.usage_tracker = LLMUsageTracker()
+
+    def _pop(self) -> ScriptedResponse:
+        if not self.responses:
+            call_number = len(self.calls) + len(self.transcriptions)
+            raise IndexError(f"MockClient has no scripted response left for call {call_number}")
+        response = self.responses.pop(0)
+        if isinstance(response, Exception):
+            raise response
+        return response
+
+    def _next(self, messages: list[Message]) -> ScriptedResponse:
+        self.calls.append(list(messages))
+        return self._pop()
+
+    async def invoke(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
+    ) -> Message | BaseModel:
+        response = self._next(messages)
+        if output_type:
+            if isinstance(response, dict):
+                return output_type.model_validate(response)
+            if not isinstance(response, output_type):
+                raise TypeError(f"Scripted response {response!r} is not a {output_type.__name__}")
+            return response
+        if isinstance(response, Message):
+            return response
+        if isinstance(response, list):
+            return Message(role="assistant", content="".join(response))
+        if isinstance(response, str):
+            return Message(role="assistant", content=response)
+        raise TypeError(f"Scripted response {response!r} cannot be returned as a Message")
+
+    async def stream(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        partial: Optional[bool] = False,
+        max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
+    ) -> AsyncGenerator[Message, None]:
+        if output_type:
+            # Mirrors AsyncClient.stream, which does not support structured streaming yet
+            raise NotImplementedError
+        response = self._next(messages)
+        if isinstance(response, Message):
+            yield response
+        elif isinstance(response, list):
+            for chunk in response:
+                yield Message(role="assistant", content=chunk)
+        elif isinstance(response, str):
+            yield Message(role="assistant", content=response)
+        else:
+            raise TypeError(f"Scripted response {response!r} cannot be streamed as a Message")
+
+    async def transcribe(
+        self,
+        audio: Union[IO[bytes], tuple[str, bytes]],
+        model: str = "whisper-1",
+        language: Optional[str] = None,
+    ) -> str:
+        self.transcriptions.append((model, language))
+        response = self._pop()
+        if not isinstance(response, str):
+            raise TypeError(f"Scripted response {response!r} cannot be returned as a transcript")
+        return response
@@ -0,0 +1,182 @@
+import hashlib
+import json
+import os
+from typing import IO, Any, AsyncGenerator, Optional, Type, Union
+
+from pydantic import BaseModel
+
+from agentpod.client.client import AsyncClient, LLMMeta, LLMUsageTracker, Message, RequestConfig
+
+
+class CassetteNotFoundError(KeyError):
+    """Raised by ReplayClient when no recording exists for a request."""
+
+
+def _read_audio(audio: Union[IO[bytes], tuple[str, bytes]]) -> tuple[str, bytes]:
+    if isinstance(audio, tuple):
+        return audio
+    return os.path.basename(getattr(audio, "name", "audio")), audio.read()
+
+
+def transcription_hash(model: str, audio: bytes, language: Optional[str] = None) -> str:
+    payload = {
+        "model": model,
+        "audio": hashlib.sha256(audio).hexdigest(),
+        "language": language,
+    }
+    return hashlib.sha256(json.dumps(payload, sort_keys=True).encode()).hexdigest()
+
+
+class RecordingClient:
+    """Wraps an AsyncClient and writes every response to `cassette_dir`, keyed by the client's request_key."""
+
+    def __init__(self, client: AsyncClient, cassette_dir: str):
+        self.client = client
+        self.cassette_dir = cassette_dir
+        os.makedirs(cassette_dir, exist_ok=True)
+
+    @property
+    def model(self) -> LLMMeta:
+        return self.client.model
+
+    @property
+    def usage_tracker(self) -> LLMUsageTracker:
+        return self.client.usage_tracker
+
+    def _write(self, key: str, record: dict) -> None:
+        with open(os.path.join(self.cassette_dir, f"{key}.json"), "w") as f:
+            json.dump(record, f, indent=2)
+
+    async def invoke(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
+    ) -> Message | BaseModel:
+        response = await self.client.invoke(
+            messages,
+            output_type=output_type,
+            max_retries=max_retries,
+            prompt_cache_key=prompt_cache_key,
+            provider_params=provider_params,
+            seed=seed,
+        )
+        key = self.client.request_key(messages, output_type, provider_params=provider_params, seed=seed)
+        self._write(key, {**self.client._sampling_params(seed), "response": response.model_dump(mode="json")})
+        return response
+
+    async def stream(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        partial: Optional[bool] = False,
+        max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
+    ) -> AsyncGenerator[Message, None]:
+        chunks = []
+        async for chunk in self.client.stream(
+            messages,
+            output_type=output_type,
+            partial=partial,
+            max_retries=max_retries,
+            prompt_cache_key=prompt_cache_key,
+            provider_params=provider_params,
+            seed=seed,
+        ):
+            chunks.append(chunk.model_dump(mode="json"))
+            yield chunk
+        key = self.client.request_key(messages, output_type, provider_params=provider_params, seed=seed, stream=True)
+        self._write(key, {**self.client._sampling_params(seed), "chunks": chunks})
+
+    async def transcribe(
+        self,
+        audio: Union[IO[bytes], tuple[str, bytes]],
+        model: str = "whisper-1",
+        language: Optional[str] = None,
+    ) -> str:
+        # The audio is read up front so the same bytes are hashed and sent
+        filename, content = _read_audio(audio)
+        text = await self.client.transcribe((filename, content), model=model, language=language)
+        self._write(transcription_hash(model, content, language), {"text": text})
+        return text
+
+
+class ReplayClient(RequestConfig):
+    """
+    Serves responses recorded by RecordingClient without making any network calls.
+
+    Recordings are keyed by the request that was sent, so pass the same `model`, `provider_params`,
+    `temperature`, `seed` and `deterministic` the recorded AsyncClient was created with.
+    """
+
+    def __init__(
+        self,
+        cassette_dir: str,
+        model: Union[str, LLMMeta] = LLMMeta.GPT_3_5_TURBO_INSTRUCT,
+        provider_params: Optional[dict[str, Any]] = None,
+        temperature: Optional[float] = None,
+        seed: Optional[int] = None,
+        deterministic: bool = False,
+    ):
+        super().__init__(
+            model=model,
+            provider_params=provider_params,
+            temperature=temperature,
+            seed=seed,
+            deterministic=deterministic,
+        )
+        self.cassette_dir = cassette_dir
+
+        # Replayed calls cost nothing, but callers still expect a tracker to enter
+        self.usage_tracker = LLMUsageTracker()
+
+    def _read(self, key: str) -> dict:
+        path = os.path.join(self.cassette_dir, f"{key}.json")
+        if not os.path.exists(path):
+            raise CassetteNotFoundError(f"No recording found for request {key} in {self.cassette_dir}")
+        with open(path) as f:
+            return json.load(f)
+
+    async def invoke(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
+    ) -> Message | BaseModel:
+        key = self.request_key(messages, output_type, provider_params=provider_params, seed=seed)
+        record = self._read(key)
+        if output_type:
+            return output_type.model_validate(record["response"])
+        return Message.model_validate(record["response"])
+
+    async def stream(
+        self,
+        messages: list[Message],
+        output_type: Optional[Type[BaseModel]] = None,
+        partial: Optional[bool] = False,
+        max_retries: Optional[int] = 3,
+        prompt_cache_key: Optional[str] = None,
+        provider_params: Optional[dict[str, Any]] = None,
+        seed: Optional[int] = None,
+    ) -> AsyncGenerator[Message, None]:
+        key = self.request_key(messages, output_type, provider_params=provider_params, seed=seed, stream=True)
+        record = self._read(key)
+        for chunk in record["chunks"]:
+            yield Message.model_validate(chunk)
+
+    async def transcribe(
+        self,
+        audio: Union[IO[bytes], tuple[str, bytes]],
+        model: str = "whisper-1",
+        language: Optional[str] = None,
+    ) -> str:
+        _, content = _read_audio(audio)
+        return self._read(transcription_hash(model, content, language))["text"]
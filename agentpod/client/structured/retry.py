@@ -5,10 +5,11 @@ import logging
 from json import JSONDecodeError
 from typing import Any, Callable, TypeVar
 
+import openai
 from openai.types.chat import ChatCompletion
 from openai.types.completion_usage import CompletionUsage
 from pydantic import BaseModel, ValidationError
-from tenacity import AsyncRetrying, RetryError, Retrying, stop_after_attempt
+from tenacity import AsyncRetrying, RetryError, Retrying, retry_if_not_exception_type, stop_after_attempt
 from typing_extensions import ParamSpec
 
 from .exceptions import InstructorRetryException
@@ -23,6 +24,16 @@ T_Retval = TypeVar("T_Retval")
 T_ParamSpec = ParamSpec("T_ParamSpec")
 T = TypeVar("T")
 
+# Client errors that resending the same request can't fix, e.g. a prompt over the context window.
+# These surface immediately so callers such as AsyncClient's truncation loop can react to them.
+NON_RETRYABLE_ERRORS = (
+    openai.BadRequestError,
+    openai.AuthenticationError,
+    openai.PermissionDeniedError,
+    openai.NotFoundError,
+    openai.UnprocessableEntityError,
+)
+
 
 def reask_messages(response: ChatCompletion, mode: Mode, exception: Exception):
     if mode == Mode.ANTHROPIC_TOOLS:
@@ -123,6 +134,7 @@ async def retry_async(
         logger.debug(f"max_retries: {max_retries}")
         max_retries = AsyncRetrying(
             stop=stop_after_attempt(max_retries),
+            retry=retry_if_not_exception_type(NON_RETRYABLE_ERRORS),
             reraise=True,
         )
     if not isinstance(max_retries, (AsyncRetrying, Retrying)):
@@ -0,0 +1,83 @@
+from typing import TYPE_CHECKING, Callable, Optional
+
+if TYPE_CHECKING:
+    # Only imported for annotations, the client itself uses these helpers
+    from agentpod.client.client import Message
+
+# Rough OpenAI figures: ~4 characters per token, a few tokens of framing per message,
+# and a flat cost per image depending on the requested detail
+CHARS_PER_TOKEN = 4
+MESSAGE_OVERHEAD_TOKENS = 4
+LOW_DETAIL_IMAGE_TOKENS = 85
+IMAGE_TOKENS = 765
+
+
+def estimate_tokens(message: "Message") -> int:
+    """
+    Estimates the prompt tokens a message costs without needing a tokenizer.
+
+    Args:
+        message (Message): The message to estimate.
+
+    Returns:
+        int: The approximate number of tokens.
+    """
+    if isinstance(message.content, str):
+        return MESSAGE_OVERHEAD_TOKENS + len(message.content) // CHARS_PER_TOKEN
+
+    tokens = MESSAGE_OVERHEAD_TOKENS
+    for part in message.content:
+        if part.type == "image_url":
+            tokens += LOW_DETAIL_IMAGE_TOKENS if part.image_url.detail == "low" else IMAGE_TOKENS
+        else:
+            tokens += len(part.text) // CHARS_PER_TOKEN
+    return tokens
+
+
+def window_messages(
+    messages: list["Message"],
+    max_tokens: int,
+    keep_system: bool = True,
+    token_counter: Optional[Callable[["Message"], int]] = None,
+) -> list["Message"]:
+    """
+    Drops the oldest messages until the conversation fits in `max_tokens`.
+
+    The latest message is always kept, even if it alone exceeds the budget, since dropping it would
+    change what is being asked. Message order is preserved.
+
+    Args:
+        messages (list[Message]): The conversation, oldest first.
+        max_tokens (int): The prompt token budget.
+        keep_system (bool): Always keep system messages and count them against the budget first.
+        token_counter (Optional[Callable[[Message], int]]): Counts a message's tokens, defaults to estimate_tokens.
+
+    Returns:
+        list[Message]: The messages that fit, oldest first.
+    """
+    if not messages:
+        return []
+    count = token_counter or estimate_tokens
+
+    kept = [False] * len(messages)
+    budget = max_tokens
+    if keep_system:
+        for i, message in enumerate(messages):
+            if message.role == "system":
+                kept[i] = True
+                budget -= count(message)
+
+    kept[-1] = True
+    if not (keep_system and messages[-1].role == "system"):
+        budget -= count(messages[-1])
+
+    for i in range(len(messages) - 2, -1, -1):
+        if kept[i]:
+            continue
+        tokens = count(messages[i])
+        if tokens > budget:
+            break
+        kept[i] = True
+        budget -= tokens
+
+    return [message for message, keep in zip(messages, kept) if keep]
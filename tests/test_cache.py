@@ -0,0 +1,130 @@
+import unittest
+from unittest import mock
+
+from pydantic import BaseModel
+
+from agentpod.client.cache import InMemoryResponseCache, request_hash
+from agentpod.client.client import AsyncClient, LLMMeta, Message
+
+MESSAGES = [Message(role="user", content="Hello")]
+
+
+class Distance(BaseModel):
+    distance: float
+
+
+class RequestHashTest(unittest.TestCase):
+    def test_stable(self):
+        self.assertEqual(request_hash("gpt-4o", MESSAGES, seed=1), request_hash("gpt-4o", MESSAGES, seed=1))
+
+    def test_model_enum_matches_value(self):
+        self.assertEqual(request_hash(LLMMeta.GPT_4O, MESSAGES), request_hash("gpt-4o", MESSAGES))
+
+    def test_empty_values_are_ignored(self):
+        plain = request_hash("gpt-4o", MESSAGES)
+        self.assertEqual(request_hash("gpt-4o", MESSAGES, seed=None, provider_params={}, stop=[]), plain)
+
+    def test_falsy_values_are_kept(self):
+        # seed=0 and temperature=0.0 change the response, so they must not hash like an unset parameter
+        plain = request_hash("gpt-4o", MESSAGES)
+        self.assertNotEqual(request_hash("gpt-4o", MESSAGES, seed=0), plain)
+        self.assertNotEqual(request_hash("gpt-4o", MESSAGES, temperature=0.0), plain)
+        self.assertNotEqual(request_hash("gpt-4o", MESSAGES, stream=False), plain)
+
+    def test_params_change_hash(self):
+        self.assertNotEqual(request_hash("gpt-4o", MESSAGES, seed=1), request_hash("gpt-4o", MESSAGES, seed=2))
+        self.assertNotEqual(request_hash("gpt-4o", MESSAGES), request_hash("gpt-4", MESSAGES))
+        self.assertNotEqual(
+            request_hash("gpt-4o", MESSAGES), request_hash("gpt-4o", [Message(role="user", content="Hi")])
+        )
+
+
+class InMemoryResponseCacheTest(unittest.IsolatedAsyncioTestCase):
+    async def test_get_and_set(self):
+        cache = InMemoryResponseCache()
+        self.assertIsNone(await cache.get("key"))
+        await cache.set("key", "value", ttl=60)
+        self.assertEqual(await cache.get("key"), "value")
+
+    async def test_expiry(self):
+        cache = InMemoryResponseCache()
+        with mock.patch("agentpod.client.cache.time.monotonic", return_value=100.0):
+            await cache.set("key", "value", ttl=10)
+        with mock.patch("agentpod.client.cache.time.monotonic", return_value=110.0):
+            self.assertEqual(await cache.get("key"), "value")
+        with mock.patch("agentpod.client.cache.time.monotonic", return_value=110.5):
+            self.assertIsNone(await cache.get("key"))
+
+    async def test_evicts_oldest(self):
+        cache = InMemoryResponseCache(max_entries=2)
+        await cache.set("a", "1", ttl=60)
+        await cache.set("b", "2", ttl=60)
+        await cache.set("a", "3", ttl=60)
+        await cache.set("c", "4", ttl=60)
+        self.assertIsNone(await cache.get("b"))
+        self.assertEqual(await cache.get("a"), "3")
+        self.assertEqual(await cache.get("c"), "4")
+
+    async def test_single_entry(self):
+        cache = InMemoryResponseCache(max_entries=1)
+        await cache.set("a", "1", ttl=60)
+        await cache.set("b", "2", ttl=60)
+        self.assertIsNone(await cache.get("a"))
+        self.assertEqual(await cache.get("b"), "2")
+
+    def test_rejects_max_entries_below_one(self):
+        for max_entries in (0, -1):
+            with self.subTest(max_entries=max_entries), self.assertRaises(ValueError):
+                InMemoryResponseCache(max_entries=max_entries)
+
+
+class InvokeCacheTest(unittest.IsolatedAsyncioTestCase):
+    def setUp(self):
+        self.cache = InMemoryResponseCache()
+        self.client = AsyncClient(api_key="test", model=LLMMeta.GPT_4O, cache=self.cache, cache_ttl=60)
+        self.response = Message(role="assistant", content="Hi!")
+        self.client._invoke = mock.AsyncMock(return_value=self.response)
+
+    async def test_miss_stores_response(self):
+        with mock.patch.object(self.cache, "set", wraps=self.cache.set) as cache_set:
+            self.assertEqual(await self.client.invoke(MESSAGES), self.response)
+        cache_set.assert_awaited_once_with(self.client.request_key(MESSAGES), self.response.model_dump_json(), 60)
+        self.client._invoke.assert_awaited_once()
+
+    async def test_hit_skips_provider(self):
+        await self.cache.set(self.client.request_key(MESSAGES), self.response.model_dump_json(), 60)
+        cached = await self.client.invoke(MESSAGES)
+        self.assertIsInstance(cached, Message)
+        self.assertEqual(cached, self.response)
+        self.client._invoke.assert_not_awaited()
+
+    async def test_hit_rebuilds_output_type(self):
+        distance = Distance(distance=3625.0)
+        await self.cache.set(self.client.request_key(MESSAGES, Distance), distance.model_dump_json(), 60)
+        cached = await self.client.invoke(MESSAGES, output_type=Distance)
+        self.assertIsInstance(cached, Distance)
+        self.assertEqual(cached, distance)
+        self.client._invoke.assert_not_awaited()
+
+    async def test_repeated_request_is_served_from_cache(self):
+        await self.client.invoke(MESSAGES, seed=1, provider_params={"top_p": 0.5})
+        await self.client.invoke(MESSAGES, seed=1, provider_params={"top_p": 0.5})
+        self.client._invoke.assert_awaited_once()
+
+    async def test_per_call_params_change_key(self):
+        calls = [{"seed": 1}, {"seed": 2}, {"provider_params": {"top_p": 0.5}}, {"provider_params": {"top_p": 1}}]
+        for kwargs in calls:
+            await self.client.invoke(MESSAGES, **kwargs)
+        self.assertEqual(self.client._invoke.await_count, len(calls))
+        keys = {self.client.request_key(MESSAGES, **kwargs) for kwargs in calls}
+        self.assertEqual(len(keys), len(calls))
+
+    async def test_without_cache(self):
+        self.client.cache = None
+        await self.client.invoke(MESSAGES)
+        await self.client.invoke(MESSAGES)
+        self.assertEqual(self.client._invoke.await_count, 2)
+
+
+if __name__ == "__main__":
+    unittest.main()
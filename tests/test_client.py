@@ -0,0 +1,126 @@
+import unittest
+from types import SimpleNamespace
+from typing import Optional
+
+import httpx
+import openai
+
+from agentpod.client.client import AsyncClient, LLMMeta, Message
+from agentpod.client.errors import ContextLengthExceededError, LLMError
+
+REQUEST = httpx.Request("POST", "https://api.openai.com/v1/chat/completions")
+
+
+def context_length_error() -> openai.BadRequestError:
+    response = httpx.Response(400, request=REQUEST)
+    body = {"code": "context_length_exceeded", "type": "invalid_request_error"}
+    return openai.BadRequestError("This model's maximum context length is 128000 tokens", response=response, body=body)
+
+
+def conversation(turns: int) -> list[Message]:
+    messages = [Message(role="system", content="You are a helpful assistant.")]
+    for i in range(turns):
+        messages.append(Message(role="user", content=f"Question {i} " + "x" * 400))
+        messages.append(Message(role="assistant", content=f"Answer {i} " + "x" * 400))
+    messages.append(Message(role="user", content="How far is Paris from New York?"))
+    return messages
+
+
+class FakeCompletions:
+    """Rejects requests with more than `max_messages` messages as a provider would reject an oversized prompt."""
+
+    def __init__(self, max_messages: Optional[int]):
+        self.max_messages = max_messages
+        self.requests: list[list[dict]] = []
+
+    async def create(self, **kwargs):
+        self.requests.append(kwargs["messages"])
+        if self.max_messages is None or len(kwargs["messages"]) > self.max_messages:
+            raise context_length_error()
+        if kwargs["stream"]:
+            return self._stream()
+        message = SimpleNamespace(role="assistant", content="About 3,625 miles.")
+        return SimpleNamespace(usage=None, choices=[SimpleNamespace(message=message)])
+
+    async def _stream(self):
+        delta = SimpleNamespace(role="assistant", content="About 3,625 miles.")
+        yield SimpleNamespace(usage=None, choices=[SimpleNamespace(delta=delta)])
+
+
+class ContextTruncationTest(unittest.IsolatedAsyncioTestCase):
+    def client(self, max_messages: Optional[int], auto_truncate: bool = True) -> AsyncClient:
+        client = AsyncClient(api_key="test", model=LLMMeta.GPT_4O, auto_truncate=auto_truncate)
+        self.completions = FakeCompletions(max_messages)
+        client._native_client = SimpleNamespace(chat=SimpleNamespace(completions=self.completions))
+        return client
+
+    def assert_truncated(self, messages: list[Message]):
+        sizes = [len(request) for request in self.completions.requests]
+        self.assertGreater(len(sizes), 2)
+        self.assertEqual(sizes, sorted(set(sizes), reverse=True), "each retry must send fewer messages")
+        for request in self.completions.requests:
+            self.assertEqual(request[0], messages[0].to_dict())
+            self.assertEqual(request[-1], messages[-1].to_dict())
+            # The kept history is the most recent part of the conversation
+            recent = messages[len(messages) - len(request) + 1 :]
+            self.assertEqual(request[1:], [message.to_dict() for message in recent])
+
+    async def test_invoke_truncates_until_it_fits(self):
+        messages = conversation(turns=10)
+        response = await self.client(max_messages=6).invoke(messages)
+        self.assertEqual(response, Message(role="assistant", content="About 3,625 miles."))
+        self.assertLessEqual(len(self.completions.requests[-1]), 6)
+        self.assert_truncated(messages)
+
+    async def test_stream_truncates_until_it_fits(self):
+        messages = conversation(turns=10)
+        chunks = [chunk async for chunk in self.client(max_messages=6).stream(messages)]
+        self.assertEqual([chunk.content for chunk in chunks], ["About 3,625 miles."])
+        self.assertLessEqual(len(self.completions.requests[-1]), 6)
+        self.assert_truncated(messages)
+
+    async def test_invoke_reraises_when_nothing_is_left_to_drop(self):
+        messages = conversation(turns=10)
+        with self.assertRaises(ContextLengthExceededError) as raised:
+            await self.client(max_messages=None).invoke(messages)
+        self.assertIsInstance(raised.exception.__cause__, openai.BadRequestError)
+        self.assertEqual(self.completions.requests[-1], [messages[0].to_dict(), messages[-1].to_dict()])
+        self.assert_truncated(messages)
+
+    async def test_stream_reraises_when_nothing_is_left_to_drop(self):
+        messages = conversation(turns=10)
+        with self.assertRaises(ContextLengthExceededError) as raised:
+            async for _ in self.client(max_messages=None).stream(messages):
+                pass
+        self.assertIsInstance(raised.exception.__cause__, openai.BadRequestError)
+        self.assertEqual(self.completions.requests[-1], [messages[0].to_dict(), messages[-1].to_dict()])
+
+    async def test_invoke_without_auto_truncate_raises_immediately(self):
+        with self.assertRaises(ContextLengthExceededError):
+            await self.client(max_messages=6, auto_truncate=False).invoke(conversation(turns=10))
+        self.assertEqual(len(self.completions.requests), 1)
+
+    async def test_stream_without_auto_truncate_raises_immediately(self):
+        with self.assertRaises(ContextLengthExceededError):
+            async for _ in self.client(max_messages=6, auto_truncate=False).stream(conversation(turns=10)):
+                pass
+        self.assertEqual(len(self.completions.requests), 1)
+
+    async def test_other_errors_are_not_truncated(self):
+        client = self.client(max_messages=6)
+        response = httpx.Response(400, request=REQUEST)
+        error = openai.BadRequestError("Invalid value for 'temperature'", response=response, body={})
+
+        async def create(**kwargs):
+            self.completions.requests.append(kwargs["messages"])
+            raise error
+
+        self.completions.create = create
+        with self.assertRaises(LLMError) as raised:
+            await client.invoke(conversation(turns=10))
+        self.assertNotIsInstance(raised.exception, ContextLengthExceededError)
+        self.assertEqual(len(self.completions.requests), 1)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,109 @@
+import unittest
+
+import httpx
+import openai
+
+from agentpod.client.errors import (
+    ContentPolicyError,
+    ContextLengthExceededError,
+    ErrorCategory,
+    LLMAuthenticationError,
+    LLMError,
+    LLMRateLimitError,
+    LLMTimeoutError,
+    normalize_error,
+)
+
+REQUEST = httpx.Request("POST", "https://api.openai.com/v1/chat/completions")
+
+
+def status_error(
+    error_class: type[openai.APIStatusError],
+    status_code: int,
+    message: str = "error",
+    body: object = None,
+    headers: dict | None = None,
+) -> openai.APIStatusError:
+    response = httpx.Response(status_code, request=REQUEST, headers=headers)
+    return error_class(message, response=response, body=body)
+
+
+class NormalizeErrorTest(unittest.TestCase):
+    def test_context_length_from_body_code(self):
+        error = status_error(openai.BadRequestError, 400, body={"code": "context_length_exceeded"})
+        normalized = normalize_error(error, "openai")
+        self.assertIsInstance(normalized, ContextLengthExceededError)
+        self.assertEqual(normalized.category, ErrorCategory.CONTEXT_LENGTH_EXCEEDED)
+
+    def test_context_length_from_message(self):
+        # Proxies often drop the body code and only keep the provider's message
+        error = status_error(
+            openai.BadRequestError, 400, message="This model's maximum context length is 4097 tokens", body="not a dict"
+        )
+        self.assertIsInstance(normalize_error(error, "openai"), ContextLengthExceededError)
+
+    def test_content_policy_from_body_type(self):
+        error = status_error(openai.BadRequestError, 400, body={"type": "content_filter"})
+        self.assertIsInstance(normalize_error(error, "openai"), ContentPolicyError)
+
+    def test_markers_win_over_server_status(self):
+        error = status_error(openai.InternalServerError, 500, message="litellm.ContextWindowExceededError")
+        self.assertIsInstance(normalize_error(error, "openai"), ContextLengthExceededError)
+
+    def test_server_errors(self):
+        for status_code in (500, 502, 503, 529):
+            with self.subTest(status_code=status_code):
+                normalized = normalize_error(status_error(openai.APIStatusError, status_code), "openai")
+                self.assertEqual(normalized.category, ErrorCategory.SERVER)
+                self.assertIs(type(normalized), LLMError)
+
+    def test_status_categories(self):
+        cases = [
+            (openai.BadRequestError, 400, ErrorCategory.BAD_REQUEST, LLMError),
+            (openai.AuthenticationError, 401, ErrorCategory.AUTHENTICATION, LLMAuthenticationError),
+            (openai.PermissionDeniedError, 403, ErrorCategory.PERMISSION, LLMAuthenticationError),
+            (openai.NotFoundError, 404, ErrorCategory.NOT_FOUND, LLMError),
+            (openai.APIStatusError, 408, ErrorCategory.TIMEOUT, LLMTimeoutError),
+            (openai.RateLimitError, 429, ErrorCategory.RATE_LIMIT, LLMRateLimitError),
+            (openai.ConflictError, 409, ErrorCategory.UNKNOWN, LLMError),
+        ]
+        for error_class, status_code, category, normalized_class in cases:
+            with self.subTest(status_code=status_code):
+                normalized = normalize_error(status_error(error_class, status_code), "openai")
+                self.assertEqual(normalized.category, category)
+                self.assertIs(type(normalized), normalized_class)
+                self.assertEqual(normalized.status_code, status_code)
+
+    def test_retry_after_and_request_id(self):
+        error = status_error(openai.RateLimitError, 429, headers={"retry-after": "1.5", "x-request-id": "req_123"})
+        normalized = normalize_error(error, "openai")
+        self.assertEqual(normalized.retry_after, 1.5)
+        self.assertEqual(normalized.request_id, "req_123")
+        self.assertEqual(normalized.provider, "openai")
+
+    def test_retry_after_http_date_is_ignored(self):
+        error = status_error(openai.RateLimitError, 429, headers={"retry-after": "Wed, 21 Oct 2015 07:28:00 GMT"})
+        self.assertIsNone(normalize_error(error, "openai").retry_after)
+
+    def test_missing_headers(self):
+        normalized = normalize_error(status_error(openai.RateLimitError, 429), "openai")
+        self.assertIsNone(normalized.retry_after)
+        self.assertIsNone(normalized.request_id)
+
+    def test_timeout(self):
+        normalized = normalize_error(openai.APITimeoutError(request=REQUEST), "openai")
+        self.assertIsInstance(normalized, LLMTimeoutError)
+        self.assertIsNone(normalized.status_code)
+
+    def test_connection(self):
+        normalized = normalize_error(openai.APIConnectionError(request=REQUEST), "openai")
+        self.assertEqual(normalized.category, ErrorCategory.CONNECTION)
+
+    def test_unknown(self):
+        normalized = normalize_error(ValueError("boom"), "openai")
+        self.assertEqual(normalized.category, ErrorCategory.UNKNOWN)
+        self.assertEqual(normalized.message, "boom")
+
+
+if __name__ == "__main__":
+    unittest.main()
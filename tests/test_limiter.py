@@ -0,0 +1,125 @@
+import asyncio
+import unittest
+
+from agentpod.client.limiter import QueueTimeoutError, RequestLimiter
+
+
+class RequestLimiterTest(unittest.IsolatedAsyncioTestCase):
+    async def test_no_limits(self):
+        limiter = RequestLimiter()
+        async with limiter.acquire("gpt-4o"):
+            self.assertEqual(limiter.in_flight, 1)
+        self.assertEqual(limiter.in_flight, 0)
+
+    async def test_global_limit(self):
+        limiter = RequestLimiter(max_concurrency=1)
+        entered = asyncio.Event()
+        release = asyncio.Event()
+
+        async def hold():
+            async with limiter.acquire("gpt-4o"):
+                entered.set()
+                await release.wait()
+
+        holder = asyncio.create_task(hold())
+        await entered.wait()
+        waiter = asyncio.create_task(hold())
+        await asyncio.sleep(0)
+
+        self.assertEqual(limiter.in_flight, 1)
+        self.assertEqual(limiter.queue_depth, 1)
+        self.assertEqual(limiter.queue_depth_per_model["gpt-4o"], 1)
+
+        release.set()
+        await asyncio.gather(holder, waiter)
+        self.assertEqual(limiter.in_flight, 0)
+        self.assertEqual(limiter.queue_depth, 0)
+        self.assertEqual(limiter.queue_depth_per_model["gpt-4o"], 0)
+
+    async def test_queued_model_does_not_hold_global_slot(self):
+        limiter = RequestLimiter(max_concurrency=2, max_concurrency_per_model={"gpt-4o": 1})
+        release = asyncio.Event()
+
+        async def hold(model: str):
+            async with limiter.acquire(model):
+                await release.wait()
+
+        busy = asyncio.create_task(hold("gpt-4o"))
+        queued = asyncio.create_task(hold("gpt-4o"))
+        await asyncio.sleep(0)
+
+        # The queued gpt-4o request waits on its model slot, so another model can still use the second global slot
+        async with asyncio.timeout(1):
+            async with limiter.acquire("gpt-4"):
+                self.assertEqual(limiter.in_flight, 2)
+                self.assertEqual(limiter.queue_depth_per_model["gpt-4o"], 1)
+
+        release.set()
+        await asyncio.gather(busy, queued)
+
+    async def test_timeout_releases_slots(self):
+        limiter = RequestLimiter(max_concurrency=1, max_concurrency_per_model={"gpt-4o": 1}, timeout=0.01)
+        release = asyncio.Event()
+
+        async def hold():
+            async with limiter.acquire("gpt-4"):
+                await release.wait()
+
+        holder = asyncio.create_task(hold())
+        await asyncio.sleep(0)
+
+        # Gets the gpt-4o slot, then times out on the global one and must give the gpt-4o slot back
+        with self.assertRaises(QueueTimeoutError):
+            async with limiter.acquire("gpt-4o"):
+                pass
+        self.assertEqual(limiter.queue_depth, 0)
+        self.assertEqual(limiter.queue_depth_per_model["gpt-4o"], 0)
+
+        release.set()
+        await holder
+        async with limiter.acquire("gpt-4o"):
+            self.assertEqual(limiter.in_flight, 1)
+
+    async def test_cancellation_releases_slots(self):
+        limiter = RequestLimiter(max_concurrency=1, max_concurrency_per_model={"gpt-4o": 1})
+        release = asyncio.Event()
+
+        async def hold(model: str):
+            async with limiter.acquire(model):
+                await release.wait()
+
+        holder = asyncio.create_task(hold("gpt-4"))
+        await asyncio.sleep(0)
+        waiter = asyncio.create_task(hold("gpt-4o"))
+        await asyncio.sleep(0)
+        self.assertEqual(limiter.queue_depth, 1)
+
+        waiter.cancel()
+        with self.assertRaises(asyncio.CancelledError):
+            await waiter
+        self.assertEqual(limiter.queue_depth, 0)
+
+        release.set()
+        await holder
+        async with asyncio.timeout(1):
+            async with limiter.acquire("gpt-4o"):
+                self.assertEqual(limiter.in_flight, 1)
+
+    async def test_error_in_body_releases_slot(self):
+        limiter = RequestLimiter(max_concurrency=1)
+        with self.assertRaises(ValueError):
+            async with limiter.acquire("gpt-4o"):
+                raise ValueError
+        self.assertEqual(limiter.in_flight, 0)
+        async with asyncio.timeout(1):
+            async with limiter.acquire("gpt-4o"):
+                pass
+
+    def test_rejects_limits_below_one(self):
+        for kwargs in ({"max_concurrency": 0}, {"max_concurrency": -1}, {"max_concurrency_per_model": {"gpt-4o": 0}}):
+            with self.subTest(**kwargs), self.assertRaises(ValueError):
+                RequestLimiter(**kwargs)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,106 @@
+import unittest
+
+from pydantic import BaseModel
+
+from agentpod.client.client import Message
+from agentpod.client.mock import MockClient
+
+MESSAGES = [Message(role="user", content="How far is Paris from New York?")]
+
+
+class Distance(BaseModel):
+    distance: float
+
+
+class MockClientTest(unittest.IsolatedAsyncioTestCase):
+    async def test_invoke_str(self):
+        client = MockClient(responses=["Hello!"])
+        self.assertEqual(await client.invoke(MESSAGES), Message(role="assistant", content="Hello!"))
+
+    async def test_invoke_message(self):
+        message = Message(role="assistant", content="Hello!")
+        self.assertIs(await MockClient(responses=[message]).invoke(MESSAGES), message)
+
+    async def test_invoke_joins_chunks(self):
+        client = MockClient(responses=[["Par", "is"]])
+        self.assertEqual(await client.invoke(MESSAGES), Message(role="assistant", content="Paris"))
+
+    async def test_invoke_validates_dict_into_output_type(self):
+        client = MockClient(responses=[{"distance": 3625.0}])
+        self.assertEqual(await client.invoke(MESSAGES, output_type=Distance), Distance(distance=3625.0))
+
+    async def test_invoke_returns_model_instance(self):
+        distance = Distance(distance=3625.0)
+        self.assertIs(await MockClient(responses=[distance]).invoke(MESSAGES, output_type=Distance), distance)
+
+    async def test_invoke_wrong_type(self):
+        cases = [
+            ("Hello!", Distance),
+            (Distance(distance=3625.0), None),
+            ({"distance": 3625.0}, None),
+        ]
+        for response, output_type in cases:
+            with self.subTest(response=response, output_type=output_type), self.assertRaises(TypeError):
+                await MockClient(responses=[response]).invoke(MESSAGES, output_type=output_type)
+
+    async def test_stream_yields_chunks(self):
+        client = MockClient(responses=[["Par", "is"], "Hello!"])
+        self.assertEqual([chunk.content async for chunk in client.stream(MESSAGES)], ["Par", "is"])
+        self.assertEqual([chunk.content async for chunk in client.stream(MESSAGES)], ["Hello!"])
+
+    async def test_stream_wrong_type(self):
+        with self.assertRaises(TypeError):
+            async for _ in MockClient(responses=[{"distance": 3625.0}]).stream(MESSAGES):
+                pass
+
+    async def test_stream_output_type_not_implemented(self):
+        with self.assertRaises(NotImplementedError):
+            async for _ in MockClient(responses=["Hello!"]).stream(MESSAGES, output_type=Distance):
+                pass
+
+    async def test_raises_scripted_exception(self):
+        error = ValueError("provider down")
+        client = MockClient(responses=[error, "Hello!"])
+        with self.assertRaises(ValueError) as raised:
+            await client.invoke(MESSAGES)
+        self.assertIs(raised.exception, error)
+        self.assertEqual(await client.invoke(MESSAGES), Message(role="assistant", content="Hello!"))
+
+    async def test_runs_out_of_responses(self):
+        client = MockClient(responses=["Hello!"])
+        await client.invoke(MESSAGES)
+        with self.assertRaisesRegex(IndexError, "call 2"):
+            await client.invoke(MESSAGES)
+
+    async def test_records_calls(self):
+        client = MockClient(responses=["Hello!", ["Hi"]])
+        follow_up = MESSAGES + [Message(role="user", content="And in kilometers?")]
+        await client.invoke(MESSAGES)
+        async for _ in client.stream(follow_up):
+            pass
+        self.assertEqual(client.calls, [MESSAGES, follow_up])
+
+    async def test_calls_are_copied(self):
+        client = MockClient(responses=["Hello!"])
+        messages = list(MESSAGES)
+        await client.invoke(messages)
+        messages.append(Message(role="assistant", content="Hello!"))
+        self.assertEqual(client.calls, [MESSAGES])
+
+    async def test_transcribe(self):
+        client = MockClient(responses=["How far is Paris?", "Hello!"])
+        self.assertEqual(await client.transcribe(("question.wav", b""), language="en"), "How far is Paris?")
+        self.assertEqual(client.transcriptions, [("whisper-1", "en")])
+        self.assertEqual(client.calls, [])
+        await client.invoke(MESSAGES)
+        with self.assertRaisesRegex(IndexError, "call 3"):
+            await client.transcribe(("question.wav", b""))
+        self.assertEqual(client.transcriptions, [("whisper-1", "en"), ("whisper-1", None)])
+
+    async def test_transcribe_wrong_type(self):
+        with self.assertRaises(TypeError):
+            await MockClient(responses=[{"text": "Hello!"}]).transcribe(("question.wav", b""))
+
+
+if __name__ == "__main__":
+    unittest.main()
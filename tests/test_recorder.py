@@ -0,0 +1,130 @@
+import json
+import os
+import shutil
+import tempfile
+import unittest
+from types import SimpleNamespace
+from typing import Optional
+from unittest import mock
+
+from pydantic import BaseModel
+
+from agentpod.client.client import AsyncClient, LLMMeta, Message
+from agentpod.client.recorder import CassetteNotFoundError, RecordingClient, ReplayClient
+
+MESSAGES = [Message(role="user", content="How far is Paris from New York?")]
+AUDIO = ("question.wav", b"RIFF....WAVEfmt ")
+SETTINGS = {"model": LLMMeta.GPT_4O, "provider_params": {"top_p": 0.5}, "deterministic": True}
+
+
+class Distance(BaseModel):
+    distance: float
+
+
+def chunk(content: str, role: Optional[str] = None) -> SimpleNamespace:
+    return SimpleNamespace(usage=None, choices=[SimpleNamespace(delta=SimpleNamespace(role=role, content=content))])
+
+
+class FakeCompletions:
+    """Stands in for `chat.completions` of the native client, recording every request."""
+
+    def __init__(self):
+        self.requests = []
+
+    async def create(self, **kwargs):
+        self.requests.append(kwargs)
+        if kwargs["stream"]:
+            return self._stream()
+        message = SimpleNamespace(role="assistant", content="About 3,625 miles.")
+        return SimpleNamespace(usage=None, choices=[SimpleNamespace(message=message)])
+
+    async def _stream(self):
+        yield chunk("About ", role="assistant")
+        yield chunk("3,625 miles.")
+
+
+class RecordReplayTest(unittest.IsolatedAsyncioTestCase):
+    def setUp(self):
+        self.cassette_dir = tempfile.mkdtemp()
+        self.addCleanup(shutil.rmtree, self.cassette_dir)
+
+        client = AsyncClient(api_key="test", **SETTINGS)
+        self.completions = FakeCompletions()
+        self.structured_create = mock.AsyncMock(return_value=Distance(distance=3625.0))
+        self.transcriptions_create = mock.AsyncMock(return_value=SimpleNamespace(text="How far?", duration=2.0))
+        client._native_client = SimpleNamespace(
+            chat=SimpleNamespace(completions=self.completions),
+            audio=SimpleNamespace(transcriptions=SimpleNamespace(create=self.transcriptions_create)),
+        )
+        client._structured_client = SimpleNamespace(
+            chat=SimpleNamespace(completions=SimpleNamespace(create=self.structured_create))
+        )
+
+        self.recorder = RecordingClient(client, self.cassette_dir)
+        self.replayer = ReplayClient(self.cassette_dir, **SETTINGS)
+
+    def offline(self):
+        return mock.patch("socket.socket", side_effect=AssertionError("ReplayClient touched the network"))
+
+    async def test_invoke(self):
+        recorded = await self.recorder.invoke(MESSAGES, provider_params={"user": "u1"})
+        with self.offline():
+            replayed = await self.replayer.invoke(MESSAGES, provider_params={"user": "u1"})
+        self.assertEqual(replayed, recorded)
+
+        # The client-level settings were sent, so they must be part of the key the replay found
+        request = self.completions.requests[0]
+        self.assertEqual(request["extra_body"], {"top_p": 0.5, "user": "u1"})
+        self.assertEqual((request["temperature"], request["seed"]), (0.0, 42))
+
+    async def test_invoke_output_type(self):
+        recorded = await self.recorder.invoke(MESSAGES, output_type=Distance, seed=7)
+        with self.offline():
+            replayed = await self.replayer.invoke(MESSAGES, output_type=Distance, seed=7)
+        self.assertEqual(replayed, Distance(distance=3625.0))
+        self.assertEqual(replayed, recorded)
+        self.assertEqual(self.structured_create.await_args.kwargs["seed"], 7)
+
+    async def test_stream(self):
+        recorded = [chunk async for chunk in self.recorder.stream(MESSAGES)]
+        with self.offline():
+            replayed = [chunk async for chunk in self.replayer.stream(MESSAGES)]
+        self.assertEqual(replayed, recorded)
+        self.assertEqual("".join(chunk.content for chunk in replayed), "About 3,625 miles.")
+
+        # Streamed and non-streamed responses are recorded separately
+        with self.assertRaises(CassetteNotFoundError):
+            await self.replayer.invoke(MESSAGES)
+
+    async def test_transcribe(self):
+        recorded = await self.recorder.transcribe(AUDIO, language="en")
+        with self.offline():
+            replayed = await self.replayer.transcribe(AUDIO, language="en")
+        self.assertEqual(replayed, recorded)
+        with self.assertRaises(CassetteNotFoundError):
+            await self.replayer.transcribe(AUDIO, language="fr")
+
+    async def test_cassette_stores_sampling_params(self):
+        await self.recorder.invoke(MESSAGES, seed=7)
+        (name,) = os.listdir(self.cassette_dir)
+        with open(os.path.join(self.cassette_dir, name)) as f:
+            record = json.load(f)
+        self.assertEqual((record["temperature"], record["seed"]), (0.0, 7))
+
+    async def test_settings_are_part_of_the_key(self):
+        await self.recorder.invoke(MESSAGES)
+        mismatches = {
+            "not deterministic": (ReplayClient(self.cassette_dir, **{**SETTINGS, "deterministic": False}), {}),
+            "no provider_params": (ReplayClient(self.cassette_dir, **{**SETTINGS, "provider_params": None}), {}),
+            "other model": (ReplayClient(self.cassette_dir, **{**SETTINGS, "model": "gpt-4"}), {}),
+            "per-call seed": (self.replayer, {"seed": 1}),
+            "per-call provider_params": (self.replayer, {"provider_params": {"top_p": 1}}),
+        }
+        for mismatch, (replayer, kwargs) in mismatches.items():
+            with self.subTest(mismatch), self.assertRaises(CassetteNotFoundError):
+                await replayer.invoke(MESSAGES, **kwargs)
+        self.assertEqual(await self.replayer.invoke(MESSAGES, seed=42), await self.replayer.invoke(MESSAGES))
+
+
+if __name__ == "__main__":
+    unittest.main()
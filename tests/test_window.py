@@ -0,0 +1,77 @@
+import unittest
+
+from agentpod.client.client import ImagePart, Message
+from agentpod.client.window import (
+    IMAGE_TOKENS,
+    LOW_DETAIL_IMAGE_TOKENS,
+    MESSAGE_OVERHEAD_TOKENS,
+    estimate_tokens,
+    window_messages,
+)
+
+
+def ten_tokens(message: Message) -> int:
+    return 10
+
+
+class EstimateTokensTest(unittest.TestCase):
+    def test_text(self):
+        message = Message(role="user", content="a" * 40)
+        self.assertEqual(estimate_tokens(message), MESSAGE_OVERHEAD_TOKENS + 10)
+
+    def test_images(self):
+        images = [
+            ImagePart.from_url("https://example.com/a.png", detail="low"),
+            ImagePart.from_url("https://example.com/b.png"),
+        ]
+        message = Message.with_images("a" * 8, images)
+        self.assertEqual(estimate_tokens(message), MESSAGE_OVERHEAD_TOKENS + 2 + LOW_DETAIL_IMAGE_TOKENS + IMAGE_TOKENS)
+
+
+class WindowMessagesTest(unittest.TestCase):
+    def setUp(self):
+        self.system = Message(role="system", content="system")
+        self.a = Message(role="user", content="a")
+        self.b = Message(role="assistant", content="b")
+        self.c = Message(role="user", content="c")
+
+    def test_empty(self):
+        self.assertEqual(window_messages([], 100), [])
+
+    def test_everything_fits(self):
+        messages = [self.system, self.a, self.b, self.c]
+        self.assertEqual(window_messages(messages, 40, token_counter=ten_tokens), messages)
+
+    def test_drops_oldest_first(self):
+        messages = [self.system, self.a, self.b, self.c]
+        self.assertEqual(window_messages(messages, 30, token_counter=ten_tokens), [self.system, self.b, self.c])
+
+    def test_keeps_last_message_over_budget(self):
+        messages = [self.a, self.b, self.c]
+        self.assertEqual(window_messages(messages, 0, keep_system=False, token_counter=ten_tokens), [self.c])
+
+    def test_budget_smaller_than_system_messages(self):
+        messages = [self.system, self.a, self.b, self.c]
+        self.assertEqual(window_messages(messages, 5, token_counter=ten_tokens), [self.system, self.c])
+
+    def test_system_message_last(self):
+        # The last message is also a kept system message, so it must only be counted once
+        messages = [self.a, self.b, self.system]
+        self.assertEqual(window_messages(messages, 20, token_counter=ten_tokens), [self.b, self.system])
+
+    def test_keep_system_false_drops_system(self):
+        messages = [self.system, self.a, self.b, self.c]
+        self.assertEqual(
+            window_messages(messages, 30, keep_system=False, token_counter=ten_tokens), [self.a, self.b, self.c]
+        )
+
+    def test_window_is_contiguous(self):
+        # b doesn't fit, so a must not be kept either even though it would fit on its own
+        sizes = {"a": 1, "b": 50, "c": 1}
+        messages = [self.a, self.b, self.c]
+        windowed = window_messages(messages, 10, keep_system=False, token_counter=lambda m: sizes[m.content])
+        self.assertEqual(windowed, [self.c])
+
+
+if __name__ == "__main__":
+    unittest.main()